@@ -24,7 +24,7 @@ func ExampleMarkdown_writeFieldType() {
 		return
 	}
 
-	if err = md.Para("# Example"); err != nil {
+	if _, err = md.Writer.Write([]byte("# Example\n")); err != nil {
 		fmt.Println("Got error", err)
 		return
 	}
@@ -127,7 +127,9 @@ func ExampleMarkdown_transport() {
 	// Content-Length: 14
 	// Content-Type: application/json
 	//
-	// {"foo": "bar"}
+	// {
+	//   "foo": "bar"
+	// }
 	// ```
 	// that was the response
 
@@ -0,0 +1,577 @@
+// Package schema reflects over a Go struct and produces a neutral
+// intermediate representation (a tree of Node) that can be rendered
+// by more than one output format (the markdown table in
+// autodoc.Markdown, the OpenAPI/JSON Schema renderer in
+// autodoc.OpenAPI, and so on) without re-doing the reflection walk
+// for each one.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+)
+
+// Kind identifies the shape of a Node.
+type Kind int
+
+// The kinds a Node can have.
+const (
+	Bool Kind = iota
+	Number
+	String
+	Object
+	Array
+	Union
+)
+
+// String renders a Kind the way autodoc.Markdown has always rendered
+// it in its Type column.
+func (k Kind) String() string {
+	switch k {
+	case Bool:
+		return "bool"
+	case Number:
+		return "number"
+	case String:
+		return "string"
+	case Object:
+		return "Object"
+	case Array:
+		return "Array"
+	case Union:
+		return "oneOf"
+	}
+	return "unknown"
+}
+
+// Node is one field in the schema IR produced by Walk.  The root
+// Node returned by Walk represents the struct itself: its Name and
+// Description are empty and its Fields holds the top-level fields.
+type Node struct {
+	// Name is the wire name of the field (from the json/doc tag, or
+	// the Go field name as a fallback).
+	Name string
+
+	// Kind is the shape of this node.
+	Kind Kind
+
+	// TypeName is the declared Go name of a named struct type, used
+	// by renderers that need to reference the type by name (for
+	// example OpenAPI's $ref).  It is empty for anonymous structs and
+	// for non-struct kinds.
+	TypeName string
+
+	// Format refines Kind with a renderer-specific hint, e.g.
+	// "int32", "int64", "float" or "double" for Number.
+	Format string
+
+	Description string
+	ReadOnly    bool
+	Optional    bool
+	Nullable    bool
+
+	// Override is a fixed display string (e.g. "string (date-time)")
+	// from Options.TypeOverrides, taking the place of Kind/Format for
+	// renderers that show free text (Markdown's Type column).  Set,
+	// Kind is still a best-effort approximation (see fieldType).
+	Override string
+
+	// Fields holds the nested fields, when Kind == Object and IsMap
+	// is false.
+	Fields []Node
+
+	// IsMap marks an Object node that came from a Go map rather than
+	// a struct: MapKey holds the key type's label and Elem the value
+	// type's node (Go reflection can't enumerate map entries ahead of
+	// time, so there is no Fields list).
+	IsMap  bool
+	MapKey string
+
+	// Elem holds the element type, when Kind == Array, or the value
+	// type, when IsMap is true.
+	Elem *Node
+
+	// Enum lists the allowed values for a field tagged `doc:"enum"`,
+	// taken from Options.EnumValues.  Empty if the field isn't tagged
+	// or its type wasn't registered.
+	Enum []string
+
+	// Variants holds the possible concrete implementations, when
+	// Kind == Union.  Populated from Options.Types: every registered
+	// type that implements the field's interface becomes a variant.
+	Variants []Node
+
+	// Discriminator is the wire name of the field used to tell
+	// Variants apart, when one of them declares it via
+	// `doc:"discriminator=<name>,value=<value>"`.  This is the same
+	// name fieldName would assign that field (so it reflects
+	// NameStyle/NameFunc and any explicit json/doc tag name), not the
+	// `<name>` text from the tag, which is otherwise unused.  Empty if
+	// no variant declares a discriminator.
+	Discriminator string
+
+	// DiscriminatorValues maps a variant's TypeName to its
+	// discriminator value, when Discriminator is set.
+	DiscriminatorValues map[string]string
+}
+
+// Options configures Walk.
+type Options struct {
+	// Types lists the concrete types registered via
+	// Markdown.RegisterTypes / OpenAPI.RegisterTypes.  When a field's
+	// Go type is an interface, every type here that implements it
+	// becomes a Union variant.
+	Types []reflect.Type
+
+	// TypeOverrides forces specific types to a fixed display string
+	// instead of being reflected into, e.g. time.Time -> "string
+	// (date-time)".  Keyed by the exact reflect.Type, checked before
+	// unwrapping pointers/slices, so it also applies to e.g. []byte.
+	TypeOverrides map[reflect.Type]string
+
+	// EnumValues lists the allowed values for a named type, keyed by
+	// reflect.Type.  Go reflection has no way to enumerate a type's
+	// package-level const declarations, so fields tagged `doc:"enum"`
+	// look their values up here instead.
+	EnumValues map[reflect.Type][]string
+
+	// NameStyle picks how a field's wire name is derived from its Go
+	// name when neither a json nor a doc tag supplies one explicitly.
+	// It is ignored for fields with an explicit tag name.
+	NameStyle NameStyle
+
+	// NameFunc, when set, overrides NameStyle: it is called for every
+	// field that has no explicit tag name, and its return value is
+	// used as the wire name.
+	NameFunc func(reflect.StructField) string
+
+	// PromotedPrefix is prepended (as "prefix.field") to the fields of
+	// an embedded (anonymous) struct field that Go promotes to the
+	// parent's level, instead of the default of flattening them in
+	// with no prefix at all, matching encoding/json's own promotion
+	// behavior. An embedded field with an explicit tag name is never
+	// promoted: it is walked like any other named Object field.
+	PromotedPrefix string
+}
+
+// NameStyle is the naming convention applied to a field's Go name when
+// deriving its wire name, for the fallback case where no json/doc tag
+// gives one explicitly.
+type NameStyle int
+
+// The styles a field name can be converted to.
+const (
+	// AsIs uses the Go field name unchanged. This is the default.
+	AsIs NameStyle = iota
+	// SnakeCase lower_cases the name and joins words with underscores.
+	SnakeCase
+	// CamelCase lowers the first word and capitalizes the rest,
+	// joining them with no separator, e.g. "helloWorld".
+	CamelCase
+	// KebabCase lower_cases the name and joins words with hyphens.
+	KebabCase
+)
+
+// applyNameStyle converts a Go identifier to the given NameStyle,
+// splitting it into words first so that acronyms (e.g. "HTTPStatus")
+// are treated as a single word rather than one letter per word.
+func applyNameStyle(style NameStyle, name string) string {
+	switch style {
+	case SnakeCase:
+		return strings.ToLower(strings.Join(splitWords(name), "_"))
+	case KebabCase:
+		return strings.ToLower(strings.Join(splitWords(name), "-"))
+	case CamelCase:
+		return toCamelCase(splitWords(name))
+	}
+	return name
+}
+
+func toCamelCase(words []string) string {
+	var b strings.Builder
+	for ii, word := range words {
+		if word == "" {
+			continue
+		}
+		if ii == 0 {
+			b.WriteString(strings.ToLower(word))
+			continue
+		}
+		b.WriteString(strings.ToUpper(word[:1]))
+		b.WriteString(strings.ToLower(word[1:]))
+	}
+	return b.String()
+}
+
+// splitWords breaks a Go identifier into words at case boundaries,
+// keeping runs of uppercase letters (acronyms like "HTTP" or "ID")
+// together as one word: "HTTPStatusCode" -> ["HTTP", "Status", "Code"].
+func splitWords(name string) []string {
+	runes := []rune(name)
+	if len(runes) == 0 {
+		return nil
+	}
+
+	var words []string
+	start := 0
+	for ii := 1; ii < len(runes); ii++ {
+		prevUpper := unicode.IsUpper(runes[ii-1])
+		curUpper := unicode.IsUpper(runes[ii])
+		switch {
+		case !prevUpper && curUpper:
+			words = append(words, string(runes[start:ii]))
+			start = ii
+		case prevUpper && curUpper && ii+1 < len(runes) && unicode.IsLower(runes[ii+1]):
+			words = append(words, string(runes[start:ii]))
+			start = ii
+		}
+	}
+	return append(words, string(runes[start:]))
+}
+
+// Walk reflects over v (a struct, or a pointer to one) and produces
+// the schema IR for it.
+func Walk(v interface{}, opts Options) (*Node, error) {
+	t := reflect.TypeOf(v)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	root := &Node{Kind: Object, TypeName: t.Name()}
+	if err := walkFields(root, t, opts); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func walkFields(parent *Node, t reflect.Type, opts Options) error {
+	structType, err := derefStruct(t)
+	if err != nil {
+		return err
+	}
+
+	for ii := 0; ii < structType.NumField(); ii++ {
+		f := structType.Field(ii)
+
+		field, err := walkField(f, opts)
+		if err != nil {
+			return err
+		}
+
+		if f.Anonymous && !hasExplicitName(f) && field.Kind == Object && !field.IsMap {
+			parent.Fields = append(parent.Fields, promoteFields(opts.PromotedPrefix, field.Fields)...)
+			continue
+		}
+
+		parent.Fields = append(parent.Fields, *field)
+	}
+	return nil
+}
+
+// walkMapFields populates elem's struct fields when a map's value
+// type is (eventually) a struct, descending through any number of
+// nested maps first, e.g. map[string]map[string]T. It does nothing
+// when the value type bottoms out in something other than a struct,
+// such as a scalar or a slice.
+func walkMapFields(elem *Node, t reflect.Type, opts Options) error {
+	if elem == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if elem.IsMap {
+		return walkMapFields(elem.Elem, t.Elem(), opts)
+	}
+	if elem.Kind != Object {
+		return nil
+	}
+	return walkFields(elem, t, opts)
+}
+
+// derefStruct unwraps pointers down to the underlying struct type,
+// returning an error instead of panicking when t is something Elem()
+// can't be called on, e.g. an interface that failed to walk as a
+// union.
+func derefStruct(t reflect.Type) (reflect.Type, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("schema: expected a struct or pointer to struct, got %v", t.Kind())
+	}
+	return t, nil
+}
+
+// hasExplicitName reports whether f carries a tag-supplied wire name,
+// as opposed to falling back to its Go field name.
+func hasExplicitName(f reflect.StructField) bool {
+	tag, ok := f.Tag.Lookup("doc")
+	if !ok {
+		tag = f.Tag.Get("json")
+	}
+	parts := strings.Split(tag, ",")
+	if len(parts) > 0 && parts[0] != "" && parts[0] != "-" && !isFlag(parts[0]) {
+		return true
+	}
+	jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+	return jsonName != "" && jsonName != "-"
+}
+
+// promoteFields flattens an embedded struct's fields into its
+// parent's, the way encoding/json promotes them, optionally under a
+// fixed prefix instead of Go's usual prefix-less promotion.
+func promoteFields(prefix string, fields []Node) []Node {
+	if prefix == "" {
+		return fields
+	}
+
+	result := make([]Node, len(fields))
+	for ii, field := range fields {
+		field.Name = prefix + "." + field.Name
+		result[ii] = field
+	}
+	return result
+}
+
+func walkField(f reflect.StructField, opts Options) (*Node, error) {
+	tag, ok := f.Tag.Lookup("doc")
+	if !ok {
+		tag = f.Tag.Get("json")
+	}
+	parts := strings.Split(tag, ",")
+
+	node := &Node{
+		Name:        fieldName(f, parts, opts),
+		Description: f.Tag.Get("help"),
+		ReadOnly:    contains(parts, "readonly"),
+		Optional:    contains(parts, "omitempty"),
+	}
+
+	if err := fieldType(node, f.Type, parts, opts); err != nil {
+		return nil, err
+	}
+
+	if contains(parts, "enum") {
+		enumType := f.Type
+		for enumType.Kind() == reflect.Ptr {
+			enumType = enumType.Elem()
+		}
+		node.Enum = opts.EnumValues[enumType]
+	}
+
+	containerType := f.Type
+	for containerType.Kind() == reflect.Ptr {
+		containerType = containerType.Elem()
+	}
+
+	switch {
+	case node.Kind == Object && node.IsMap:
+		if err := walkMapFields(node.Elem, containerType.Elem(), opts); err != nil {
+			return nil, err
+		}
+	case node.Kind == Object:
+		if err := walkFields(node, f.Type, opts); err != nil {
+			return nil, err
+		}
+	case node.Kind == Array:
+		if node.Elem != nil && node.Elem.Kind == Object {
+			if err := walkFields(node.Elem, containerType.Elem(), opts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return node, nil
+}
+
+// walkUnion populates node as a Union from every registered type
+// that implements the interface type t.
+func walkUnion(node *Node, t reflect.Type, opts Options) error {
+	node.Kind = Union
+
+	for _, candidate := range opts.Types {
+		if !candidate.Implements(t) {
+			continue
+		}
+
+		concrete := candidate
+		for concrete.Kind() == reflect.Ptr {
+			concrete = concrete.Elem()
+		}
+
+		variant := &Node{Kind: Object, TypeName: concrete.Name()}
+		if err := walkFields(variant, concrete, opts); err != nil {
+			return err
+		}
+
+		if name, value := variantDiscriminator(concrete, opts); name != "" {
+			node.Discriminator = name
+			if node.DiscriminatorValues == nil {
+				node.DiscriminatorValues = map[string]string{}
+			}
+			node.DiscriminatorValues[variant.TypeName] = value
+		}
+
+		node.Variants = append(node.Variants, *variant)
+	}
+
+	return nil
+}
+
+// variantDiscriminator looks for a field tagged
+// `doc:"discriminator=<name>,value=<value>"` on a union variant's
+// concrete struct type.  The `<name>` in the tag is only a marker that
+// this field is the discriminator; the returned name is the field's
+// actual wire name, the same one fieldName would assign it, so it
+// stays in sync with NameStyle/NameFunc and the property Variants'
+// schemas are actually rendered with.
+func variantDiscriminator(t reflect.Type, opts Options) (name, value string) {
+	for ii := 0; ii < t.NumField(); ii++ {
+		f := t.Field(ii)
+		tag, ok := f.Tag.Lookup("doc")
+		if !ok {
+			tag = f.Tag.Get("json")
+		}
+		parts := strings.Split(tag, ",")
+
+		isDiscriminator := false
+		for _, part := range parts {
+			switch {
+			case strings.HasPrefix(part, "discriminator="):
+				isDiscriminator = true
+			case strings.HasPrefix(part, "value="):
+				value = strings.TrimPrefix(part, "value=")
+			}
+		}
+		if isDiscriminator {
+			return fieldName(f, parts, opts), value
+		}
+	}
+	return "", ""
+}
+
+func fieldName(f reflect.StructField, parts []string, opts Options) string {
+	// parts[0] is only a name when it isn't itself a flag; that lets
+	// `doc:"enum"` or `doc:"discriminator=kind,value=circle"` carry
+	// flags/metadata on their own, without a leading comma, without
+	// clobbering the field's wire name.
+	if len(parts) > 0 && parts[0] != "" && parts[0] != "-" && !isFlag(parts[0]) {
+		return parts[0]
+	}
+	if jsonName := strings.Split(f.Tag.Get("json"), ",")[0]; jsonName != "" && jsonName != "-" {
+		return jsonName
+	}
+	if opts.NameFunc != nil {
+		return opts.NameFunc(f)
+	}
+	return applyNameStyle(opts.NameStyle, f.Name)
+}
+
+func isFlag(part string) bool {
+	if strings.Contains(part, "=") {
+		return true
+	}
+	switch part {
+	case "readonly", "omitempty", "embed", "enum":
+		return true
+	}
+	return false
+}
+
+func fieldType(node *Node, t reflect.Type, parts []string, opts Options) error {
+	if override, ok := opts.TypeOverrides[t]; ok {
+		node.Kind = String
+		node.Override = override
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		node.Kind = Bool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		node.Kind = Number
+		node.Format = numberFormat(t.Kind())
+	case reflect.Array, reflect.Slice:
+		node.Kind = Array
+		elem := &Node{}
+		if err := fieldType(elem, t.Elem(), parts, opts); err != nil {
+			return err
+		}
+		node.Elem = elem
+	case reflect.Map:
+		node.Kind = Object
+		node.IsMap = true
+		node.MapKey = typeLabel(t.Key())
+		elem := &Node{}
+		if err := fieldType(elem, t.Elem(), parts, opts); err != nil {
+			return err
+		}
+		node.Elem = elem
+	case reflect.Ptr:
+		node.Nullable = true
+		return fieldType(node, t.Elem(), parts, opts)
+	case reflect.String:
+		node.Kind = String
+	case reflect.Struct:
+		node.Kind = Object
+		if t.Name() != "" && !contains(parts, "embed") {
+			node.TypeName = t.Name()
+		}
+	case reflect.Interface:
+		return walkUnion(node, t, opts)
+	default:
+		return fmt.Errorf("unsupported field type %v", t.Name())
+	}
+
+	return nil
+}
+
+// typeLabel gives a short label for a map key/value type that isn't
+// itself walked into, e.g. for the `Object<K,V>` notation in
+// Markdown's Type column.
+func typeLabel(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Struct:
+		if t.Name() != "" {
+			return t.Name()
+		}
+		return "Object"
+	}
+	return t.String()
+}
+
+func numberFormat(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int32, reflect.Uint32:
+		return "int32"
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64:
+		return "int64"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	}
+	return ""
+}
+
+func contains(array []string, element string) bool {
+	for _, elt := range array {
+		if elt == element {
+			return true
+		}
+	}
+	return false
+}
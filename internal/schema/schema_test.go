@@ -0,0 +1,233 @@
+package schema
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type shape interface{ isShape() }
+
+type circle struct {
+	Kind   string `doc:"discriminator=kind,value=circle"`
+	Radius int
+}
+
+func (circle) isShape() {}
+
+type square struct {
+	Kind string `doc:"discriminator=kind,value=square"`
+	Side int
+}
+
+func (square) isShape() {}
+
+func TestWalkUnion(t *testing.T) {
+	root, err := Walk(&struct {
+		Shape shape
+	}{}, Options{
+		Types: []reflect.Type{reflect.TypeOf(circle{}), reflect.TypeOf(square{})},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	field := root.Fields[0]
+	if field.Kind != Union || len(field.Variants) != 2 {
+		t.Fatalf("got %+v, want a 2-variant union", field)
+	}
+	if field.Discriminator != "Kind" {
+		t.Errorf("got Discriminator %q, want %q", field.Discriminator, "Kind")
+	}
+	if field.DiscriminatorValues["circle"] != "circle" || field.DiscriminatorValues["square"] != "square" {
+		t.Errorf("got DiscriminatorValues %v, want circle/square", field.DiscriminatorValues)
+	}
+
+	for _, variant := range field.Variants {
+		if variant.Fields[0].Name != field.Discriminator {
+			t.Errorf("variant %s: discriminator field is named %q, want it to match Discriminator %q",
+				variant.TypeName, variant.Fields[0].Name, field.Discriminator)
+		}
+	}
+}
+
+func TestWalkMap(t *testing.T) {
+	root, err := Walk(&struct {
+		Scores map[string]int
+	}{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	field := root.Fields[0]
+	if field.Kind != Object || !field.IsMap {
+		t.Fatalf("got Kind=%v IsMap=%v, want Object map", field.Kind, field.IsMap)
+	}
+	if field.MapKey != "string" {
+		t.Errorf("got MapKey %q, want %q", field.MapKey, "string")
+	}
+	if field.Elem == nil || field.Elem.Kind != Number {
+		t.Errorf("got Elem %+v, want Number", field.Elem)
+	}
+}
+
+func TestWalkTypeOverride(t *testing.T) {
+	root, err := Walk(&struct {
+		Created time.Time
+	}{}, Options{
+		TypeOverrides: map[reflect.Type]string{
+			reflect.TypeOf(time.Time{}): "string (date-time)",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	field := root.Fields[0]
+	if field.Override != "string (date-time)" {
+		t.Errorf("got Override %q, want %q", field.Override, "string (date-time)")
+	}
+}
+
+func TestWalkEnum(t *testing.T) {
+	type Color int
+
+	root, err := Walk(&struct {
+		Color Color `doc:"enum"`
+	}{}, Options{
+		EnumValues: map[reflect.Type][]string{
+			reflect.TypeOf(Color(0)): {"red", "green", "blue"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	field := root.Fields[0]
+	if !reflect.DeepEqual(field.Enum, []string{"red", "green", "blue"}) {
+		t.Errorf("got Enum %v, want [red green blue]", field.Enum)
+	}
+}
+
+func TestWalkUnionDiscriminatorRespectsNameStyle(t *testing.T) {
+	root, err := Walk(&struct {
+		Shape shape
+	}{}, Options{
+		Types:     []reflect.Type{reflect.TypeOf(circle{}), reflect.TypeOf(square{})},
+		NameStyle: SnakeCase,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	field := root.Fields[0]
+	if field.Discriminator != "kind" {
+		t.Errorf("got Discriminator %q, want %q", field.Discriminator, "kind")
+	}
+	for _, variant := range field.Variants {
+		if variant.Fields[0].Name != "kind" {
+			t.Errorf("variant %s: discriminator field is named %q, want %q", variant.TypeName, variant.Fields[0].Name, "kind")
+		}
+	}
+}
+
+func TestWalkNameStyle(t *testing.T) {
+	tests := []struct {
+		style NameStyle
+		want  string
+	}{
+		{AsIs, "UserID"},
+		{SnakeCase, "user_id"},
+		{KebabCase, "user-id"},
+		{CamelCase, "userId"},
+	}
+
+	for _, tt := range tests {
+		root, err := Walk(&struct{ UserID string }{}, Options{NameStyle: tt.style})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := root.Fields[0].Name; got != tt.want {
+			t.Errorf("style %v: got name %q, want %q", tt.style, got, tt.want)
+		}
+	}
+}
+
+func TestWalkNameFunc(t *testing.T) {
+	root, err := Walk(&struct{ UserID string }{}, Options{
+		NameFunc: func(f reflect.StructField) string { return "x_" + f.Name },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := root.Fields[0].Name; got != "x_UserID" {
+		t.Errorf("got name %q, want %q", got, "x_UserID")
+	}
+}
+
+func TestWalkEmbeddedPromotion(t *testing.T) {
+	type Base struct {
+		ID string
+	}
+
+	root, err := Walk(&struct {
+		Base
+		Name string
+	}{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range root.Fields {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"ID", "Name"}) {
+		t.Errorf("got fields %v, want [ID Name]", names)
+	}
+}
+
+func TestWalkEmbeddedPromotionPrefix(t *testing.T) {
+	type Base struct {
+		ID string
+	}
+
+	root, err := Walk(&struct {
+		Base
+		Name string
+	}{}, Options{PromotedPrefix: "base"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, f := range root.Fields {
+		names = append(names, f.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"base.ID", "Name"}) {
+		t.Errorf("got fields %v, want [base.ID Name]", names)
+	}
+}
+
+func TestWalkMapOfMaps(t *testing.T) {
+	type Leaf struct {
+		Value string
+	}
+
+	root, err := Walk(&struct {
+		Grid map[string]map[string]Leaf
+	}{}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	outer := root.Fields[0]
+	if !outer.IsMap || outer.Elem == nil || !outer.Elem.IsMap {
+		t.Fatalf("got %+v, want a map of maps", outer)
+	}
+
+	leaf := outer.Elem.Elem
+	if leaf == nil || leaf.Kind != Object || len(leaf.Fields) != 1 || leaf.Fields[0].Name != "Value" {
+		t.Fatalf("got leaf %+v, want a single Value field", leaf)
+	}
+}
@@ -1,12 +1,16 @@
 package autodoc
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"reflect"
 	"strings"
+	"time"
+
+	"github.com/tvastar/autodoc/internal/schema"
 )
 
 // NewMarkdown returns a new markdown instance
@@ -15,13 +19,64 @@ func NewMarkdown(fname string) (*Markdown, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &Markdown{Writer: w}, nil
+	return &Markdown{Writer: w, TypeOverrides: defaultTypeOverrides()}, nil
 }
 
 // Markdown implements markdown documentation.
 type Markdown struct {
 	Writer io.WriteCloser
 	types  []reflect.Type
+
+	// TypeOverrides forces specific types to a fixed display string
+	// in the Type column instead of being reflected into, e.g.
+	// time.Time -> "string (date-time)".  NewMarkdown pre-populates
+	// this with entries for time.Time, time.Duration, json.Number and
+	// []byte; add to the map (rather than replacing it) to extend it,
+	// e.g. for a UUID type.
+	TypeOverrides map[reflect.Type]string
+
+	// EnumValues lists the allowed values for a named type, keyed by
+	// reflect.Type.  A field tagged `doc:"enum"` whose type is
+	// registered here has its allowed values listed in the
+	// Description column.
+	EnumValues map[reflect.Type][]string
+
+	// NameStyle picks the wire name for a field that has no explicit
+	// json/doc tag name, e.g. SnakeCase turns "UserID" into
+	// "user_id". Defaults to AsIs, which uses the Go field name
+	// unchanged.
+	NameStyle NameStyle
+
+	// NameFunc, when set, overrides NameStyle for deriving the wire
+	// name of a field with no explicit tag name.
+	NameFunc func(reflect.StructField) string
+
+	// PromotedPrefix is prepended (as "prefix.field") to the fields of
+	// an embedded struct field instead of promoting them to the
+	// parent with no prefix at all, which is what Go (and this
+	// package, by default) does for embedded fields.
+	PromotedPrefix string
+}
+
+// NameStyle is the naming convention WriteStructTable falls back to
+// for a field with no explicit json/doc tag name.
+type NameStyle = schema.NameStyle
+
+// The styles a field name can be converted to; see Markdown.NameStyle.
+const (
+	AsIs      = schema.AsIs
+	SnakeCase = schema.SnakeCase
+	CamelCase = schema.CamelCase
+	KebabCase = schema.KebabCase
+)
+
+func defaultTypeOverrides() map[reflect.Type]string {
+	return map[reflect.Type]string{
+		reflect.TypeOf(time.Time{}):      "string (date-time)",
+		reflect.TypeOf(time.Duration(0)): "string",
+		reflect.TypeOf(json.Number("")):  "number",
+		reflect.TypeOf([]byte(nil)):      "string (base64)",
+	}
 }
 
 // Transport returns a http.RoundTripper that wraps the provided
@@ -55,10 +110,22 @@ func (m *Markdown) RegisterTypes(vs ...interface{}) {
 //
 // Nested structs are treated as with url-encoding: the names are
 // specified via field.subfield (or field[].subfield).
+//
+// Embedded struct fields are promoted to their parent's level, like
+// encoding/json does, unless PromotedPrefix is set; a field with no
+// explicit json/doc tag name falls back to its Go field name, run
+// through NameStyle or NameFunc if set.
 func (m *Markdown) WriteStructTable(v interface{}) error {
-	t := reflect.TypeOf(v)
-	for t.Kind() == reflect.Ptr {
-		t = t.Elem()
+	root, err := schema.Walk(v, schema.Options{
+		Types:          m.types,
+		TypeOverrides:  m.TypeOverrides,
+		EnumValues:     m.EnumValues,
+		NameStyle:      m.NameStyle,
+		NameFunc:       m.NameFunc,
+		PromotedPrefix: m.PromotedPrefix,
+	})
+	if err != nil {
+		return err
 	}
 
 	header := `
@@ -69,16 +136,12 @@ func (m *Markdown) WriteStructTable(v interface{}) error {
 		return err
 	}
 
-	return m.writeStructFields("", t)
+	return m.writeNodeFields("", root.Fields)
 }
 
-func (m *Markdown) writeStructFields(namePrefix string, v reflect.Type) error {
-	for v.Kind() != reflect.Struct {
-		v = v.Elem()
-	}
-
-	for kk := 0; kk < v.NumField(); kk++ {
-		if err := m.writeStructField(namePrefix, v.Field(kk)); err != nil {
+func (m *Markdown) writeNodeFields(namePrefix string, fields []schema.Node) error {
+	for kk := range fields {
+		if err := m.writeNode(namePrefix, fields[kk]); err != nil {
 			return err
 		}
 	}
@@ -86,65 +149,53 @@ func (m *Markdown) writeStructFields(namePrefix string, v reflect.Type) error {
 	return nil
 }
 
-func (m *Markdown) writeStructField(namePrefix string, f reflect.StructField) error {
-	tag, ok := f.Tag.Lookup("doc")
-	if !ok {
-		tag = f.Tag.Get("json")
-	}
-	parts := strings.Split(tag, ",")
+func (m *Markdown) writeNode(namePrefix string, n schema.Node) error {
+	name := namePrefix + n.Name
+	sType := nodeTypeColumn(n)
+	attribs := m.structFieldAttributes(n.ReadOnly, n.Optional)
+	description := nodeDescription(n)
 
-	name := namePrefix + m.structFieldName(f, parts)
-	sType, err := m.structFieldType(f.Type, parts)
+	_, err := fmt.Fprintf(m.Writer, "| %s | %s %s | %s |\n", name, sType, attribs, description)
 	if err != nil {
 		return err
 	}
-	description := m.structDescription(f)
-	attribs := m.structFieldAttributes(contains(parts, "readonly"), contains(parts, "omitempty"))
 
-	_, err = fmt.Fprintf(m.Writer, "| %s | %s %s | %s |\n", name, sType, attribs, description)
-	if err == nil && (sType == "Object" || sType == "Array") {
-		if sType == "Object" {
-			sType = "."
-		} else {
-			sType = "[]."
+	switch {
+	case n.Kind == schema.Object && n.IsMap:
+		return m.writeMapElemFields(name+"{}", n.Elem)
+	case n.Kind == schema.Object:
+		return m.writeNodeFields(name+".", n.Fields)
+	case n.Kind == schema.Array:
+		if n.Elem != nil && n.Elem.Kind == schema.Object {
+			return m.writeNodeFields(name+"[].", n.Elem.Fields)
+		}
+	case n.Kind == schema.Union:
+		for kk := range n.Variants {
+			variant := n.Variants[kk]
+			if err := m.writeNodeFields(name+"("+variant.TypeName+").", variant.Fields); err != nil {
+				return err
+			}
 		}
-		return m.writeStructFields(name+sType, f.Type)
 	}
 
-	return err
+	return nil
 }
 
-func (m *Markdown) structFieldName(f reflect.StructField, parts []string) string {
-	if len(parts) > 0 && parts[0] != "" && parts[0] != "-" {
-		return parts[0]
+// writeMapElemFields renders a map value's struct fields, descending
+// through any number of nested maps first, e.g. map[string]map[string]T
+// renders as "{}{}.field". Does nothing when the value bottoms out in
+// something other than a struct.
+func (m *Markdown) writeMapElemFields(prefix string, elem *schema.Node) error {
+	if elem == nil {
+		return nil
 	}
-	// TODO: convert to snake case
-	return f.Name
-}
-
-func (m *Markdown) structFieldType(t reflect.Type, parts []string) (string, error) {
-	switch t.Kind() {
-	case reflect.Bool:
-		return "bool", nil
-	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
-		reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16,
-		reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
-		return "number", nil
-	case reflect.Array, reflect.Slice:
-		return "Array", nil
-		// case reflect.Interface TODO union types
-	case reflect.Ptr:
-		return m.structFieldType(t.Elem(), parts)
-	case reflect.String:
-		return "string", nil
-	case reflect.Struct:
-		if t.Name() == "" || contains(parts, "embed") {
-			return "Object", nil
-		}
-		return t.Name(), nil
+	if elem.IsMap {
+		return m.writeMapElemFields(prefix+"{}", elem.Elem)
 	}
-
-	return "", fmt.Errorf("unsupported field type %v", t.Name())
+	if elem.Kind != schema.Object {
+		return nil
+	}
+	return m.writeNodeFields(prefix+".", elem.Fields)
 }
 
 func (m *Markdown) structFieldAttributes(readonly, optional bool) string {
@@ -162,15 +213,47 @@ func (m *Markdown) structFieldAttributes(readonly, optional bool) string {
 	return "(" + strings.Join(result, " ") + ")"
 }
 
-func (m *Markdown) structDescription(f reflect.StructField) string {
-	return f.Tag.Get("help")
-}
+// nodeTypeColumn renders the Type column for a schema node: an
+// overridden type is shown by its override text, a named struct type
+// by name, a map as `Object<K,V>`, a union by its variant names, and
+// everything else by its Kind.
+func nodeTypeColumn(n schema.Node) string {
+	if n.Override != "" {
+		return n.Override
+	}
 
-func contains(array []string, element string) bool {
-	for _, elt := range array {
-		if elt == element {
-			return true
+	switch n.Kind {
+	case schema.Object:
+		if n.IsMap {
+			valueType := "unknown"
+			if n.Elem != nil {
+				valueType = nodeTypeColumn(*n.Elem)
+			}
+			return fmt.Sprintf("Object<%s,%s>", n.MapKey, valueType)
+		}
+		if n.TypeName != "" {
+			return n.TypeName
 		}
+	case schema.Union:
+		names := make([]string, len(n.Variants))
+		for kk := range n.Variants {
+			names[kk] = n.Variants[kk].TypeName
+		}
+		return "oneOf(" + strings.Join(names, ", ") + ")"
+	}
+	return n.Kind.String()
+}
+
+// nodeDescription renders the Description column for a schema node,
+// appending any enum values from a `doc:"enum"` field.
+func nodeDescription(n schema.Node) string {
+	if len(n.Enum) == 0 {
+		return n.Description
+	}
+
+	enum := "one of: " + strings.Join(n.Enum, ", ")
+	if n.Description == "" {
+		return enum
 	}
-	return false
+	return n.Description + " (" + enum + ")"
 }
@@ -0,0 +1,333 @@
+package autodoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/tvastar/autodoc/internal/schema"
+)
+
+// NewOpenAPI returns a new OpenAPI document builder.
+func NewOpenAPI(title, version string) *OpenAPI {
+	return &OpenAPI{
+		Title:   title,
+		Version: version,
+		schemas: map[string]interface{}{},
+		paths:   map[string]map[string]*openAPIOperation{},
+	}
+}
+
+// OpenAPI builds an OpenAPI 3.0 document from the same reflection
+// pipeline that backs Markdown.WriteStructTable.
+type OpenAPI struct {
+	Title   string
+	Version string
+
+	types   []reflect.Type
+	schemas map[string]interface{}
+	paths   map[string]map[string]*openAPIOperation
+}
+
+// RegisterTypes registers concrete object types, exactly like
+// Markdown.RegisterTypes, so interface fields can be documented as a
+// `oneOf` schema.
+func (o *OpenAPI) RegisterTypes(vs ...interface{}) {
+	for _, v := range vs {
+		o.types = append(o.types, reflect.TypeOf(v))
+	}
+}
+
+type openAPIOperation struct {
+	requestBody interface{}
+	response    interface{}
+}
+
+// AddSchema walks v (a struct, or a pointer to one) and adds it to
+// the document's components/schemas, returning a `$ref` pointing at
+// it.  v must be a named struct type.
+func (o *OpenAPI) AddSchema(v interface{}) (string, error) {
+	root, err := schema.Walk(v, schema.Options{Types: o.types})
+	if err != nil {
+		return "", err
+	}
+	if root.TypeName == "" {
+		return "", fmt.Errorf("autodoc: AddSchema requires a named struct type")
+	}
+
+	o.registerSchema(root)
+	return "#/components/schemas/" + root.TypeName, nil
+}
+
+// RecordOperation adds a path+method operation to the document. req
+// and resp describe the request body and the (200) response body,
+// and may each be:
+//
+//   - a Go struct (or pointer to one), walked via reflection exactly
+//     like AddSchema;
+//   - raw bytes ([]byte or json.RawMessage), such as a body captured
+//     off the wire by TransportMarkdownRecorder, in which case the
+//     schema is inferred structurally from the sample if it parses as
+//     JSON, and otherwise omitted: a form-encoded, multipart or
+//     protobuf body isn't a schema-inference failure, it's just not
+//     JSON; or
+//   - nil, to omit that side of the operation entirely.
+func (o *OpenAPI) RecordOperation(method, path string, req, resp interface{}) error {
+	reqSchema, err := o.operationSchema(req)
+	if err != nil {
+		return fmt.Errorf("request: %w", err)
+	}
+
+	respSchema, err := o.operationSchema(resp)
+	if err != nil {
+		return fmt.Errorf("response: %w", err)
+	}
+
+	if o.paths[path] == nil {
+		o.paths[path] = map[string]*openAPIOperation{}
+	}
+	o.paths[path][strings.ToUpper(method)] = &openAPIOperation{requestBody: reqSchema, response: respSchema}
+	return nil
+}
+
+func (o *OpenAPI) operationSchema(v interface{}) (interface{}, error) {
+	switch data := v.(type) {
+	case nil:
+		return nil, nil
+	case []byte:
+		if s := inferJSONSchema(data); s != nil {
+			return s, nil
+		}
+		return nil, nil
+	case json.RawMessage:
+		if s := inferJSONSchema([]byte(data)); s != nil {
+			return s, nil
+		}
+		return nil, nil
+	default:
+		root, err := schema.Walk(v, schema.Options{Types: o.types})
+		if err != nil {
+			return nil, err
+		}
+		return o.schemaFor(root), nil
+	}
+}
+
+// Document returns the OpenAPI document as a JSON-marshalable value.
+func (o *OpenAPI) Document() map[string]interface{} {
+	paths := map[string]interface{}{}
+	for path, methods := range o.paths {
+		operations := map[string]interface{}{}
+		for method, op := range methods {
+			operations[strings.ToLower(method)] = op.document()
+		}
+		paths[path] = operations
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.0",
+		"info": map[string]interface{}{
+			"title":   o.Title,
+			"version": o.Version,
+		},
+		"components": map[string]interface{}{
+			"schemas": o.schemas,
+		},
+		"paths": paths,
+	}
+}
+
+// WriteJSON marshals the document as indented JSON.
+func (o *OpenAPI) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(o.Document())
+}
+
+func (op *openAPIOperation) document() map[string]interface{} {
+	result := map[string]interface{}{}
+
+	if op.requestBody != nil {
+		result["requestBody"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": op.requestBody},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{}
+	if op.response != nil {
+		responses["200"] = map[string]interface{}{
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": op.response},
+			},
+		}
+	} else {
+		responses["200"] = map[string]interface{}{"description": "OK"}
+	}
+	result["responses"] = responses
+
+	return result
+}
+
+// schemaFor renders a schema.Node as an OpenAPI schema object,
+// registering named struct types into components/schemas and
+// replacing them with a `$ref` instead of inlining them again.
+func (o *OpenAPI) schemaFor(n *schema.Node) map[string]interface{} {
+	result := map[string]interface{}{}
+
+	switch n.Kind {
+	case schema.Bool:
+		result["type"] = "boolean"
+	case schema.String:
+		result["type"] = "string"
+	case schema.Number:
+		result["type"] = "number"
+		if n.Format != "" {
+			result["format"] = n.Format
+		}
+	case schema.Object:
+		switch {
+		case n.IsMap:
+			valueSchema := map[string]interface{}{}
+			if n.Elem != nil {
+				valueSchema = o.schemaFor(n.Elem)
+			}
+			result["type"] = "object"
+			result["additionalProperties"] = valueSchema
+		case n.TypeName != "":
+			o.registerSchema(n)
+			result["$ref"] = "#/components/schemas/" + n.TypeName
+		default:
+			result = o.inlineObject(n)
+		}
+	case schema.Array:
+		items := map[string]interface{}{}
+		if n.Elem != nil {
+			items = o.schemaFor(n.Elem)
+		}
+		result["type"] = "array"
+		result["items"] = items
+	case schema.Union:
+		variants := make([]interface{}, len(n.Variants))
+		mapping := map[string]interface{}{}
+		for kk := range n.Variants {
+			variant := &n.Variants[kk]
+			ref := "#/components/schemas/" + variant.TypeName
+			o.registerSchema(variant)
+			variants[kk] = map[string]interface{}{"$ref": ref}
+			if value, ok := n.DiscriminatorValues[variant.TypeName]; ok {
+				mapping[value] = ref
+			}
+		}
+		result["oneOf"] = variants
+		if n.Discriminator != "" {
+			discriminator := map[string]interface{}{"propertyName": n.Discriminator}
+			if len(mapping) > 0 {
+				discriminator["mapping"] = mapping
+			}
+			result["discriminator"] = discriminator
+		}
+	}
+
+	if len(n.Enum) > 0 {
+		values := make([]interface{}, len(n.Enum))
+		for kk, value := range n.Enum {
+			values[kk] = value
+		}
+		result["enum"] = values
+	}
+
+	return result
+}
+
+func (o *OpenAPI) inlineObject(n *schema.Node) map[string]interface{} {
+	props := map[string]interface{}{}
+	required := []string{}
+
+	for kk := range n.Fields {
+		f := &n.Fields[kk]
+		fieldSchema := o.schemaFor(f)
+		if f.Description != "" {
+			fieldSchema["description"] = f.Description
+		}
+		if f.ReadOnly {
+			fieldSchema["readOnly"] = true
+		}
+		if f.Nullable {
+			fieldSchema["nullable"] = true
+		}
+		props[f.Name] = fieldSchema
+
+		if !f.Optional {
+			required = append(required, f.Name)
+		}
+	}
+
+	result := map[string]interface{}{"type": "object", "properties": props}
+	if len(required) > 0 {
+		result["required"] = required
+	}
+	return result
+}
+
+func (o *OpenAPI) registerSchema(n *schema.Node) {
+	if _, ok := o.schemas[n.TypeName]; ok {
+		return
+	}
+	o.schemas[n.TypeName] = map[string]interface{}{} // placeholder breaks self-reference cycles
+	o.schemas[n.TypeName] = o.inlineObject(n)
+}
+
+// inferJSONSchema builds a best-effort JSON Schema from a sample
+// JSON document, for use when the Go type that produced it isn't
+// available (e.g. a body captured off the wire). It returns nil when
+// data is empty or isn't valid JSON (a form-encoded, multipart or
+// protobuf body, or a still-compressed one): an unrecognized body
+// means the schema is unknown, not that recording should fail.
+func inferJSONSchema(data []byte) map[string]interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+
+	var sample interface{}
+	if err := json.Unmarshal(data, &sample); err != nil {
+		return nil
+	}
+	return inferSchema(sample)
+}
+
+func inferSchema(v interface{}) map[string]interface{} {
+	switch val := v.(type) {
+	case nil:
+		return map[string]interface{}{"nullable": true}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	case float64:
+		return map[string]interface{}{"type": "number"}
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case []interface{}:
+		items := map[string]interface{}{}
+		if len(val) > 0 {
+			items = inferSchema(val[0])
+		}
+		return map[string]interface{}{"type": "array", "items": items}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for k := range val {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		props := map[string]interface{}{}
+		for _, k := range keys {
+			props[k] = inferSchema(val[k])
+		}
+		return map[string]interface{}{"type": "object", "properties": props}
+	}
+	return map[string]interface{}{}
+}
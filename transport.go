@@ -1,10 +1,18 @@
 package autodoc
 
 import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/url"
+	"sort"
 	"strings"
 )
 
@@ -61,8 +69,43 @@ type TransportMarkdownRecorder struct {
 	// ResponsePostamble is written to the markdown after the
 	// response.
 	ResponsePostamble string
+
+	// BodyDecoders allows additional Content-Encoding values to be
+	// decoded into readable text before the body is written to the
+	// markdown.  The key is the encoding name as it appears in the
+	// Content-Encoding header (e.g. "br"), compared case
+	// insensitively.
+	//
+	// gzip and deflate are always supported and do not need to be
+	// registered here; use this to add others such as brotli.
+	BodyDecoders map[string]func(io.Reader) (io.Reader, error)
+
+	// Formatters reformats a body for human reading based on its
+	// Content-Type, once Content-Encoding/Transfer-Encoding have
+	// already been unwrapped.  The key is a media type such as
+	// "application/json", or a wildcard of the form
+	// "application/*+json" matching any subtype ending in "+json".
+	// An exact match wins over a wildcard.
+	//
+	// application/json, application/x-www-form-urlencoded and
+	// multipart/form-data are always supported and do not need to be
+	// registered here.  Use this to add others, such as a formatter
+	// for application/protobuf or application/grpc backed by a
+	// proto.Message registry and a jsonpb marshaler.
+	Formatters map[string]BodyFormatter
+
+	// OpenAPI, when set, has each successful round trip recorded
+	// into it via OpenAPI.RecordOperation, keyed by the request
+	// method and URL path, so a full spec can be generated from a
+	// test run.
+	OpenAPI *OpenAPI
 }
 
+// BodyFormatter renders a decoded body of the given media type (and
+// its Content-Type parameters, e.g. "boundary" or "charset") as
+// markdown-friendly text.
+type BodyFormatter func(data []byte, mediaType string, params map[string]string) (string, error)
+
 // WithRequestInfo updates the request preamble and postamble.
 func (t *TransportMarkdownRecorder) WithRequestInfo(preamble, postamble string) *TransportMarkdownRecorder {
 	t.RequestPreamble = preamble
@@ -84,7 +127,8 @@ func (t *TransportMarkdownRecorder) WithSkipHeaders(skip ...string) *TransportMa
 }
 
 func (t *TransportMarkdownRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
-	if err := t.recordRequest(t.Writer, req); err != nil {
+	reqBody, err := t.recordRequest(t.Writer, req)
+	if err != nil {
 		return nil, err
 	}
 
@@ -93,78 +137,87 @@ func (t *TransportMarkdownRecorder) RoundTrip(req *http.Request) (*http.Response
 		return nil, err
 	}
 
-	if err := t.recordResponse(t.Writer, resp); err != nil {
+	respBody, err := t.recordResponse(t.Writer, resp)
+	if err != nil {
 		return nil, err
 	}
 
+	if t.OpenAPI != nil {
+		if err := t.OpenAPI.RecordOperation(req.Method, req.URL.Path, reqBody, respBody); err != nil {
+			return nil, err
+		}
+	}
+
 	return resp, nil
 }
 
-func (t *TransportMarkdownRecorder) recordRequest(f io.Writer, req *http.Request) error {
+func (t *TransportMarkdownRecorder) recordRequest(f io.Writer, req *http.Request) ([]byte, error) {
 	if _, err := f.Write([]byte(t.RequestPreamble)); err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, err := fmt.Fprintf(f, "```\n%s %s\n", req.Method, req.URL.RequestURI()); err != nil {
-		return err
+		return nil, err
 	}
 
 	var buf strings.Builder
 	if err := req.Header.WriteSubset(&buf, t.skipHeaders(req.Header)); err != nil {
-		return err
+		return nil, err
 	}
 
 	headers := strings.ReplaceAll(buf.String(), "\r", "")
 	if _, err := fmt.Fprintf(f, "%s\n", headers); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := t.writeBody(f, &req.Body); err != nil {
-		return err
+	body, err := t.writeBody(f, &req.Body, req.Header)
+	if err != nil {
+		return nil, err
 	}
 
 	if _, err := f.Write([]byte("\n```\n")); err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, err := f.Write([]byte(t.RequestPostamble)); err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	return body, nil
 }
 
-func (t *TransportMarkdownRecorder) recordResponse(f io.Writer, res *http.Response) error {
+func (t *TransportMarkdownRecorder) recordResponse(f io.Writer, res *http.Response) ([]byte, error) {
 	if _, err := f.Write([]byte(t.ResponsePreamble)); err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, err := fmt.Fprintf(f, "```\n%s %s\n", res.Proto, res.Status); err != nil {
-		return err
+		return nil, err
 	}
 
 	var buf strings.Builder
 	if err := res.Header.WriteSubset(&buf, t.skipHeaders(res.Header)); err != nil {
-		return err
+		return nil, err
 	}
 
 	headers := strings.ReplaceAll(buf.String(), "\r", "")
 	if _, err := fmt.Fprintf(f, "%s\n", headers); err != nil {
-		return err
+		return nil, err
 	}
 
-	if err := t.writeBody(f, &res.Body); err != nil {
-		return err
+	body, err := t.writeBody(f, &res.Body, res.Header)
+	if err != nil {
+		return nil, err
 	}
 
 	if _, err := f.Write([]byte("\n```\n")); err != nil {
-		return err
+		return nil, err
 	}
 
 	if _, err := f.Write([]byte(t.ResponsePostamble)); err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return body, nil
 }
 
 func (t *TransportMarkdownRecorder) skipHeaders(h http.Header) map[string]bool {
@@ -181,22 +234,243 @@ func (t *TransportMarkdownRecorder) skipHeaders(h http.Header) map[string]bool {
 	return result
 }
 
-func (t *TransportMarkdownRecorder) writeBody(w io.Writer, r *io.ReadCloser) error {
+// writeBody writes the decoded, formatted body to w and returns those
+// same formatted bytes, so callers such as RoundTrip can feed the
+// OpenAPI recorder the markdown-friendly bytes instead of re-reading
+// (and re-decoding) the raw wire body.
+func (t *TransportMarkdownRecorder) writeBody(w io.Writer, r *io.ReadCloser, header http.Header) ([]byte, error) {
 	if *r == nil {
-		return nil
+		return nil, nil
 	}
 
 	data, err := ioutil.ReadAll(*r)
 	if err != nil {
-		return err
-	}
-	if _, err2 := w.Write(data); err2 != nil {
-		return err
+		return nil, err
 	}
 
 	(*r).Close()
-	*r = ioutil.NopCloser(strings.NewReader(string(data)))
-	return nil
+	*r = ioutil.NopCloser(bytes.NewReader(data))
+
+	decoded := t.decodeBody(data, header)
+	formatted := t.formatBody(decoded, header)
+	if _, err := w.Write(formatted); err != nil {
+		return nil, err
+	}
+
+	return formatted, nil
+}
+
+// decodeBody transparently unwraps compressed content-encoding so the
+// body written to the markdown is readable text.  It never fails the
+// request: if the body can't be decoded (unknown encoding, corrupt
+// data) the original bytes are written unchanged.  The wire body
+// itself is left untouched by the caller, which re-wraps the original
+// bytes before handing the request/response back.
+//
+// Transfer-Encoding: chunked needs no unwrapping here: net/http
+// de-chunks a response body before RoundTrip sees it and never
+// pre-chunks a request body, so by the time writeBody reads req.Body
+// or resp.Body the chunk framing is already gone.
+func (t *TransportMarkdownRecorder) decodeBody(data []byte, header http.Header) []byte {
+	var r io.Reader = bytes.NewReader(data)
+
+	for _, enc := range contentEncodings(header) {
+		decode, ok := t.bodyDecoder(enc)
+		if !ok {
+			return data
+		}
+		decoded, err := decode(r)
+		if err != nil {
+			return data
+		}
+		r = decoded
+	}
+
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		return data
+	}
+	return decoded
+}
+
+// bodyDecoder returns the decoder for a single Content-Encoding
+// value, checking user-registered BodyDecoders before the built-in
+// gzip/deflate support.
+func (t *TransportMarkdownRecorder) bodyDecoder(encoding string) (func(io.Reader) (io.Reader, error), bool) {
+	for name, decode := range t.BodyDecoders {
+		if strings.EqualFold(name, encoding) {
+			return decode, true
+		}
+	}
+
+	switch strings.ToLower(encoding) {
+	case "gzip":
+		return func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }, true
+	case "deflate":
+		return func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil }, true
+	case "", "identity":
+		return func(r io.Reader) (io.Reader, error) { return r, nil }, true
+	}
+
+	return nil, false
+}
+
+// contentEncodings splits the Content-Encoding header into its
+// individual codecs, in the order they must be undone (the reverse
+// of the order they were applied in).
+func contentEncodings(header http.Header) []string {
+	value := header.Get("Content-Encoding")
+	if value == "" {
+		return nil
+	}
+
+	parts := strings.Split(value, ",")
+	encodings := make([]string, 0, len(parts))
+	for ii := len(parts) - 1; ii >= 0; ii-- {
+		if enc := strings.TrimSpace(parts[ii]); enc != "" {
+			encodings = append(encodings, enc)
+		}
+	}
+	return encodings
+}
+
+// formatBody reformats data according to the request/response
+// Content-Type, falling back to the data unchanged when there is no
+// Content-Type, no matching formatter, or the formatter errors.
+func (t *TransportMarkdownRecorder) formatBody(data []byte, header http.Header) []byte {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		return data
+	}
+
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return data
+	}
+
+	format, ok := t.bodyFormatter(mediaType)
+	if !ok {
+		return data
+	}
+
+	formatted, err := format(data, mediaType, params)
+	if err != nil {
+		return data
+	}
+	return []byte(formatted)
+}
+
+// bodyFormatter looks up the formatter for mediaType: an exact match
+// in Formatters, then a wildcard match in Formatters, then the
+// built-in formatters.
+func (t *TransportMarkdownRecorder) bodyFormatter(mediaType string) (BodyFormatter, bool) {
+	if format, ok := t.Formatters[mediaType]; ok {
+		return format, true
+	}
+	for pattern, format := range t.Formatters {
+		if mediaTypeMatches(pattern, mediaType) {
+			return format, true
+		}
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return formatJSONBody, true
+	case mediaType == "application/x-www-form-urlencoded":
+		return formatFormBody, true
+	case mediaType == "multipart/form-data":
+		return formatMultipartBody, true
+	}
+
+	return nil, false
+}
+
+// mediaTypeMatches reports whether mediaType matches pattern, where
+// pattern may contain a single `*` wildcard, e.g. "application/*+json".
+func mediaTypeMatches(pattern, mediaType string) bool {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return pattern == mediaType
+	}
+	return strings.HasPrefix(mediaType, pattern[:star]) && strings.HasSuffix(mediaType, pattern[star+1:])
+}
+
+func formatJSONBody(data []byte, _ string, _ map[string]string) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func formatFormBody(data []byte, _ string, _ map[string]string) (string, error) {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return "", err
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var buf strings.Builder
+	buf.WriteString("| Field | Value |\n| ----- | ----- |\n")
+	for _, key := range keys {
+		for _, value := range values[key] {
+			fmt.Fprintf(&buf, "| %s | %s |\n", key, value)
+		}
+	}
+	return buf.String(), nil
+}
+
+func formatMultipartBody(data []byte, _ string, params map[string]string) (string, error) {
+	boundary, ok := params["boundary"]
+	if !ok {
+		return "", fmt.Errorf("multipart body has no boundary parameter")
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	var buf strings.Builder
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		fmt.Fprintf(&buf, "--- part: %s ---\n", part.FormName())
+		for name, values := range part.Header {
+			fmt.Fprintf(&buf, "%s: %s\n", name, strings.Join(values, ", "))
+		}
+
+		content, err := ioutil.ReadAll(part)
+		if err != nil {
+			return "", err
+		}
+		if isTextContentType(part.Header.Get("Content-Type")) {
+			buf.WriteString("\n")
+			buf.Write(content)
+			buf.WriteString("\n")
+		}
+	}
+	return buf.String(), nil
+}
+
+// isTextContentType reports whether a multipart part should have its
+// content inlined rather than just its headers listed.
+func isTextContentType(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json"
 }
 
 func (t *TransportMarkdownRecorder) transport() http.RoundTripper {
@@ -0,0 +1,183 @@
+package autodoc
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDecodeBodyGzip(t *testing.T) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Encoding": []string{"gzip"}}
+	got := rec.decodeBody(buf.Bytes(), header)
+	if string(got) != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestDecodeBodyDeflate(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Encoding": []string{"deflate"}}
+	got := rec.decodeBody(buf.Bytes(), header)
+	if string(got) != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestDecodeBodyCustomDecoder(t *testing.T) {
+	rec := &TransportMarkdownRecorder{
+		BodyDecoders: map[string]func(io.Reader) (io.Reader, error){
+			"rot13": func(r io.Reader) (io.Reader, error) {
+				data, err := ioutil.ReadAll(r)
+				if err != nil {
+					return nil, err
+				}
+				return strings.NewReader(rot13(string(data))), nil
+			},
+		},
+	}
+	header := http.Header{"Content-Encoding": []string{"rot13"}}
+	got := rec.decodeBody([]byte(rot13("hello")), header)
+	if string(got) != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestDecodeBodyIgnoresTransferEncodingHeader(t *testing.T) {
+	// A caller may set Transfer-Encoding: chunked on a request (e.g. a
+	// proxy/passthrough recorder) even though net/http never actually
+	// chunk-frames the body it hands to RoundTrip. decodeBody must not
+	// try to de-chunk it, or a real Content-Encoding: gzip body (which
+	// isn't chunk-framed) fails to parse and gets returned unchanged.
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{
+		"Content-Encoding":  []string{"gzip"},
+		"Transfer-Encoding": []string{"chunked"},
+	}
+	got := rec.decodeBody(buf.Bytes(), header)
+	if string(got) != "hello" {
+		t.Errorf("got %q, want %q", got, "hello")
+	}
+}
+
+func TestDecodeBodyUnknownEncodingLeavesDataUnchanged(t *testing.T) {
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Encoding": []string{"br"}}
+	data := []byte("raw bytes")
+	got := rec.decodeBody(data, header)
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %q, want unchanged %q", got, data)
+	}
+}
+
+func rot13(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return 'a' + (r-'a'+13)%26
+		case r >= 'A' && r <= 'Z':
+			return 'A' + (r-'A'+13)%26
+		}
+		return r
+	}, s)
+}
+
+func TestFormatBodyJSON(t *testing.T) {
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	got := string(rec.formatBody([]byte(`{"foo":"bar"}`), header))
+	want := "{\n  \"foo\": \"bar\"\n}"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatBodyForm(t *testing.T) {
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Type": []string{"application/x-www-form-urlencoded"}}
+	got := string(rec.formatBody([]byte("b=2&a=1"), header))
+	want := "| Field | Value |\n| ----- | ----- |\n| a | 1 |\n| b | 2 |\n"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatBodyMultipart(t *testing.T) {
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	if err := w.WriteField("name", "gopher"); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Type": []string{`multipart/form-data; boundary=` + w.Boundary()}}
+	got := string(rec.formatBody(buf.Bytes(), header))
+	if !strings.Contains(got, "--- part: name ---") || !strings.Contains(got, "gopher") {
+		t.Errorf("got %q, want it to contain the name part and its value", got)
+	}
+}
+
+func TestFormatBodyCustomFormatterWildcard(t *testing.T) {
+	rec := &TransportMarkdownRecorder{
+		Formatters: map[string]BodyFormatter{
+			"application/*+custom": func(data []byte, mediaType string, _ map[string]string) (string, error) {
+				return "custom:" + mediaType + ":" + string(data), nil
+			},
+		},
+	}
+	header := http.Header{"Content-Type": []string{"application/vnd.thing+custom"}}
+	got := string(rec.formatBody([]byte("payload"), header))
+	want := "custom:application/vnd.thing+custom:payload"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestFormatBodyUnknownContentTypeLeavesDataUnchanged(t *testing.T) {
+	rec := &TransportMarkdownRecorder{}
+	header := http.Header{"Content-Type": []string{"application/octet-stream"}}
+	data := []byte{0x01, 0x02, 0x03}
+	got := rec.formatBody(data, header)
+	if !bytes.Equal(got, data) {
+		t.Errorf("got %v, want unchanged %v", got, data)
+	}
+}